@@ -0,0 +1,83 @@
+package api
+
+import (
+	"github.com/grafana/grafana/pkg/api/dtos"
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/guardian"
+)
+
+// CompareDashboardVersions handles
+// GET /api/dashboards/id/:id/versions/:a/compare/:b.
+func CompareDashboardVersions(c *models.ReqContext) Response {
+	dashboardId := c.ParamsInt64(":dashboardId")
+
+	g := guardian.New(dashboardId, c.OrgId, c.SignedInUser)
+	if canView, err := g.CanView(); err != nil || !canView {
+		return dashboardGuardianResponse(err)
+	}
+
+	query := models.GetDashboardVersionDiffQuery{
+		DashboardId: dashboardId,
+		OrgId:       c.OrgId,
+		Original:    c.ParamsInt(":a"),
+		New:         c.ParamsInt(":b"),
+	}
+
+	if err := bus.Dispatch(&query); err != nil {
+		switch err {
+		case models.ErrDashboardVersionNotFound:
+			return Error(404, "Dashboard version not found", err)
+		case models.ErrDashboardNotFound:
+			return Error(404, "Dashboard not found", err)
+		default:
+			return Error(500, "Failed to compare dashboard versions", err)
+		}
+	}
+
+	ops := make([]dtos.JSONPatchOp, len(query.Result))
+	for i, op := range query.Result {
+		ops[i] = dtos.JSONPatchOp{Op: op.Op, Path: op.Path, Value: op.Value}
+	}
+
+	return JSON(200, ops)
+}
+
+// MergeDashboardVersions handles POST /api/dashboards/id/:id/versions/merge.
+func MergeDashboardVersions(c *models.ReqContext, apiCmd dtos.MergeDashboardVersionsCommand) Response {
+	dashboardId := c.ParamsInt64(":dashboardId")
+
+	g := guardian.New(dashboardId, c.OrgId, c.SignedInUser)
+	if canView, err := g.CanView(); err != nil || !canView {
+		return dashboardGuardianResponse(err)
+	}
+
+	cmd := models.MergeDashboardVersionsCommand{
+		DashboardId: dashboardId,
+		OrgId:       c.OrgId,
+		Base:        apiCmd.Base,
+		Ours:        apiCmd.Ours,
+		Theirs:      apiCmd.Theirs,
+	}
+
+	if err := bus.Dispatch(&cmd); err != nil {
+		switch err {
+		case models.ErrDashboardVersionNotFound:
+			return Error(404, "Dashboard version not found", err)
+		case models.ErrDashboardNotFound:
+			return Error(404, "Dashboard not found", err)
+		default:
+			return Error(500, "Failed to merge dashboard versions", err)
+		}
+	}
+
+	conflicts := make([]dtos.VersionConflict, len(cmd.Conflicts))
+	for i, c := range cmd.Conflicts {
+		conflicts[i] = dtos.VersionConflict{Path: c.Path, Base: c.Base, Ours: c.Ours, Theirs: c.Theirs}
+	}
+
+	return JSON(200, dtos.MergeDashboardVersionsResponse{
+		Dashboard: cmd.Result,
+		Conflicts: conflicts,
+	})
+}
@@ -0,0 +1,19 @@
+package api
+
+import (
+	"github.com/grafana/grafana/pkg/api/dtos"
+	"github.com/grafana/grafana/pkg/api/routing"
+	"github.com/grafana/grafana/pkg/middleware"
+)
+
+// registerDashboardVersionDiffRoutes wires the dashboard version diff and
+// three-way merge endpoints into the given route register. It's called
+// from HTTPServer.registerRoutes alongside the rest of /api/dashboards.
+func registerDashboardVersionDiffRoutes(r routing.RouteRegister) {
+	reqSignedIn := middleware.ReqSignedIn
+
+	r.Group("/api/dashboards/id/:dashboardId", func(dashboardRoute routing.RouteRegister) {
+		dashboardRoute.Get("/versions/:a/compare/:b", Wrap(CompareDashboardVersions))
+		dashboardRoute.Post("/versions/merge", bind(dtos.MergeDashboardVersionsCommand{}), Wrap(MergeDashboardVersions))
+	}, reqSignedIn)
+}
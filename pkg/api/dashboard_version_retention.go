@@ -0,0 +1,60 @@
+package api
+
+import (
+	"github.com/grafana/grafana/pkg/api/dtos"
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/guardian"
+)
+
+// GetDashboardVersionRetention handles GET /api/dashboards/id/:id/version-retention.
+func GetDashboardVersionRetention(c *models.ReqContext) Response {
+	dashboardId := c.ParamsInt64(":dashboardId")
+
+	g := guardian.New(dashboardId, c.OrgId, c.SignedInUser)
+	if canView, err := g.CanView(); err != nil || !canView {
+		return dashboardGuardianResponse(err)
+	}
+
+	query := models.GetDashboardVersionRetentionQuery{DashboardId: dashboardId, OrgId: c.OrgId}
+	if err := bus.Dispatch(&query); err != nil {
+		switch err {
+		case models.ErrDashboardVersionRetentionNotFound:
+			return JSON(200, dtos.DashboardVersionRetention{DashboardId: dashboardId})
+		case models.ErrDashboardNotFound:
+			return Error(404, "Dashboard not found", err)
+		default:
+			return Error(500, "Failed to get dashboard version retention", err)
+		}
+	}
+
+	return JSON(200, dtos.DashboardVersionRetention{
+		DashboardId:  query.Result.DashboardId,
+		KeepVersions: query.Result.KeepVersions,
+	})
+}
+
+// SetDashboardVersionRetention handles POST /api/dashboards/id/:id/version-retention.
+func SetDashboardVersionRetention(c *models.ReqContext, apiCmd dtos.SetDashboardVersionRetentionCommand) Response {
+	dashboardId := c.ParamsInt64(":dashboardId")
+
+	g := guardian.New(dashboardId, c.OrgId, c.SignedInUser)
+	if canSave, err := g.CanSave(); err != nil || !canSave {
+		return dashboardGuardianResponse(err)
+	}
+
+	cmd := models.SetDashboardVersionRetentionCommand{
+		DashboardId:  dashboardId,
+		OrgId:        c.OrgId,
+		KeepVersions: apiCmd.KeepVersions,
+	}
+
+	if err := bus.Dispatch(&cmd); err != nil {
+		if err == models.ErrDashboardNotFound {
+			return Error(404, "Dashboard not found", err)
+		}
+		return Error(500, "Failed to set dashboard version retention", err)
+	}
+
+	return Success("Dashboard version retention updated")
+}
@@ -0,0 +1,19 @@
+package api
+
+import (
+	"github.com/grafana/grafana/pkg/api/dtos"
+	"github.com/grafana/grafana/pkg/api/routing"
+	"github.com/grafana/grafana/pkg/middleware"
+)
+
+// registerDashboardVersionRetentionRoutes wires the per-dashboard version
+// retention endpoints into the given route register. It's called from
+// HTTPServer.registerRoutes alongside the rest of /api/dashboards.
+func registerDashboardVersionRetentionRoutes(r routing.RouteRegister) {
+	reqSignedIn := middleware.ReqSignedIn
+
+	r.Group("/api/dashboards/id/:dashboardId", func(dashboardRoute routing.RouteRegister) {
+		dashboardRoute.Get("/version-retention", Wrap(GetDashboardVersionRetention))
+		dashboardRoute.Post("/version-retention", bind(dtos.SetDashboardVersionRetentionCommand{}), Wrap(SetDashboardVersionRetention))
+	}, reqSignedIn)
+}
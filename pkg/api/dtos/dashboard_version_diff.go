@@ -0,0 +1,33 @@
+package dtos
+
+// JSONPatchOp is the API representation of a single RFC 6902 JSON Patch
+// operation.
+type JSONPatchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// VersionConflict is the API representation of a three-way merge conflict.
+type VersionConflict struct {
+	Path   string      `json:"path"`
+	Base   interface{} `json:"base"`
+	Ours   interface{} `json:"ours"`
+	Theirs interface{} `json:"theirs"`
+}
+
+// MergeDashboardVersionsResponse is returned by the dashboard version merge
+// endpoint: the merged dashboard JSON, plus any pointers that could not be
+// merged automatically and need resolving in the UI.
+type MergeDashboardVersionsResponse struct {
+	Dashboard interface{}       `json:"dashboard"`
+	Conflicts []VersionConflict `json:"conflicts"`
+}
+
+// MergeDashboardVersionsCommand is the request body for the dashboard
+// version merge endpoint.
+type MergeDashboardVersionsCommand struct {
+	Base   int `json:"base"`
+	Ours   int `json:"ours"`
+	Theirs int `json:"theirs"`
+}
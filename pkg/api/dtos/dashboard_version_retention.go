@@ -0,0 +1,15 @@
+package dtos
+
+// DashboardVersionRetention is the API representation of a dashboard's
+// version retention override. KeepVersions is 0 when no override has been
+// set, meaning the dashboard falls back to any tag-based or global policy.
+type DashboardVersionRetention struct {
+	DashboardId  int64 `json:"dashboardId"`
+	KeepVersions int   `json:"keepVersions"`
+}
+
+// SetDashboardVersionRetentionCommand is the request body for overriding a
+// dashboard's version retention.
+type SetDashboardVersionRetentionCommand struct {
+	KeepVersions int `json:"keepVersions"`
+}
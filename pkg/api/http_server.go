@@ -0,0 +1,15 @@
+package api
+
+import "github.com/grafana/grafana/pkg/api/routing"
+
+// HTTPServer owns the route register that every HTTP API route group wires
+// itself into.
+type HTTPServer struct {
+	RouteRegister routing.RouteRegister
+}
+
+// registerRoutes wires every HTTP API route group onto hs.RouteRegister.
+func (hs *HTTPServer) registerRoutes() {
+	registerDashboardVersionRetentionRoutes(hs.RouteRegister)
+	registerDashboardVersionDiffRoutes(hs.RouteRegister)
+}
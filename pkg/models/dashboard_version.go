@@ -0,0 +1,207 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+)
+
+// Typed errors for dashboard versions.
+var (
+	ErrDashboardVersionNotFound = errors.New("dashboard version not found")
+	ErrNoVersionsForDashboardId = errors.New("no dashboard versions found for the given DashboardId")
+)
+
+// DashboardVersionSource records how a dashboard version came to exist.
+type DashboardVersionSource string
+
+const (
+	DashboardVersionSourceUser         DashboardVersionSource = "user"
+	DashboardVersionSourcePlugin       DashboardVersionSource = "plugin"
+	DashboardVersionSourceProvisioning DashboardVersionSource = "provisioning"
+	DashboardVersionSourceAPI          DashboardVersionSource = "api"
+	DashboardVersionSourceImport       DashboardVersionSource = "import"
+)
+
+// DashboardVersion represents the dashboard version.
+type DashboardVersion struct {
+	Id            int64     `json:"id"`
+	DashboardId   int64     `json:"dashboardId"`
+	ParentVersion int       `json:"parentVersion"`
+	RestoredFrom  int       `json:"restoredFrom"`
+	Version       int       `json:"version"`
+	Created       time.Time `json:"created"`
+	CreatedBy     int64     `json:"createdBy"`
+
+	Message string           `json:"message"`
+	Data    *simplejson.Json `json:"data"`
+
+	// Source identifies what produced this version: a user edit, a plugin
+	// auto-update, provisioning, the HTTP API, or a one-off import.
+	// SourceRef further identifies the origin, e.g. "<plugin id>/<path>" for
+	// plugin-sourced versions or a file path for provisioning/import.
+	// SourceRevision is the origin's own revision marker (e.g. the plugin's
+	// dashboard revision number), when it has one.
+	Source         DashboardVersionSource `json:"source"`
+	SourceRef      string                 `json:"sourceRef"`
+	SourceRevision string                 `json:"sourceRevision"`
+}
+
+// DashboardVersionMeta extends the dashboard version model with the names
+// associated with the internal ids.
+type DashboardVersionMeta struct {
+	Id            int64     `json:"id"`
+	DashboardId   int64     `json:"dashboardId"`
+	ParentVersion int       `json:"parentVersion"`
+	RestoredFrom  int       `json:"restoredFrom"`
+	Version       int       `json:"version"`
+	Created       time.Time `json:"created"`
+
+	Message   string           `json:"message"`
+	Data      *simplejson.Json `json:"data"`
+	CreatedBy string           `json:"createdBy"`
+
+	Source         DashboardVersionSource `json:"source"`
+	SourceRef      string                 `json:"sourceRef"`
+	SourceRevision string                 `json:"sourceRevision"`
+}
+
+// GetDashboardVersionQuery fetches a single dashboard version by DashboardId and Version.
+type GetDashboardVersionQuery struct {
+	DashboardId int64
+	Version     int
+	OrgId       int64
+
+	Result *DashboardVersionMeta
+}
+
+// GetDashboardVersionsQuery fetches the version history of a dashboard.
+// Source, when set, restricts the results to versions with that provenance.
+type GetDashboardVersionsQuery struct {
+	DashboardId int64
+	OrgId       int64
+	Limit       int
+	Start       int
+	Source      DashboardVersionSource
+
+	Result []*DashboardVersionMeta
+}
+
+// GetDashboardVersionsBySourceQuery fetches every stored version that came
+// from a given source, optionally narrowed to a single SourceRef (e.g. one
+// plugin's dashboard). Used to audit what a plugin or provisioning file has
+// shipped over time.
+type GetDashboardVersionsBySourceQuery struct {
+	Source    DashboardVersionSource
+	SourceRef string
+
+	Result []*DashboardVersionMeta
+}
+
+// DeleteExpiredVersionsCommand deletes dashboard versions that are beyond
+// each dashboard's effective retention policy: an explicit per-dashboard
+// override, falling back to the highest configured tag-based policy,
+// falling back to setting.DashboardVersionsToKeep.
+//
+// KeepRecent, KeepEvery and MinSnapshotInterval add a second tier on top of
+// that policy, modeled on IAVL-style pruning: besides the KeepRecent most
+// recent versions, any version that is a multiple of KeepEvery, or that is
+// at least MinSnapshotInterval newer than the previous kept snapshot, is
+// preserved permanently. A zero field falls back to the matching
+// setting.DashboardVersions* default; when that is zero too, the snapshot
+// tier is disabled and only the effective retention policy applies.
+//
+// When MaxAge is set, a version outside the "keep latest N" window is
+// deleted only once it is also older than now - MaxAge, in the same batched
+// manner; the most recent versions are always preserved, however old they
+// are. A zero MaxAge falls back to setting.DashboardVersionsMaxAge, and
+// time-based expiration is disabled when that is zero too.
+type DeleteExpiredVersionsCommand struct {
+	KeepRecent          int
+	KeepEvery           int
+	MinSnapshotInterval time.Duration
+	MaxAge              time.Duration
+
+	DeletedRows int64
+}
+
+// ErrDashboardVersionRetentionNotFound is returned when a dashboard has no
+// per-dashboard retention override configured.
+var ErrDashboardVersionRetentionNotFound = errors.New("dashboard version retention override not found")
+
+// DashboardVersionRetention is a per-dashboard override of how many
+// versions of history to retain, taking precedence over any tag-based or
+// global default.
+type DashboardVersionRetention struct {
+	DashboardId  int64 `xorm:"pk"`
+	KeepVersions int
+}
+
+// GetDashboardVersionRetentionQuery fetches the retention override for a
+// single dashboard, if one has been set. OrgId scopes the lookup to the
+// caller's org, so a dashboard belonging to another org resolves as not
+// found rather than leaking its retention policy.
+type GetDashboardVersionRetentionQuery struct {
+	DashboardId int64
+	OrgId       int64
+
+	Result *DashboardVersionRetention
+}
+
+// SetDashboardVersionRetentionCommand sets (or, when KeepVersions <= 0,
+// clears) the per-dashboard retention override. OrgId scopes the write to
+// the caller's org, so the dashboard must belong to it.
+type SetDashboardVersionRetentionCommand struct {
+	DashboardId  int64
+	OrgId        int64
+	KeepVersions int
+}
+
+// JSONPatchOp is a single RFC 6902 JSON Patch operation.
+type JSONPatchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// VersionConflict describes a JSON pointer where the "ours" and "theirs"
+// sides of a three-way merge both diverged from "base", so neither change
+// could be applied automatically.
+type VersionConflict struct {
+	Path   string      `json:"path"`
+	Base   interface{} `json:"base"`
+	Ours   interface{} `json:"ours"`
+	Theirs interface{} `json:"theirs"`
+}
+
+// GetDashboardVersionDiffQuery computes an RFC 6902 JSON patch describing
+// how to turn the Original version's dashboard data into the New version's.
+// Elements of arrays whose items all carry a unique "id" are addressed by an
+// "id:<id>" path segment instead of a positional index, so those paths are
+// not RFC 6901 array references. OrgId scopes the lookup to the caller's org.
+type GetDashboardVersionDiffQuery struct {
+	DashboardId int64
+	OrgId       int64
+	Original    int
+	New         int
+
+	Result []JSONPatchOp
+}
+
+// MergeDashboardVersionsCommand performs a three-way merge of a dashboard's
+// JSON across Base, Ours and Theirs. Changes made on only one side relative
+// to Base, or changed on both sides to the same value, are applied
+// automatically; JSON pointers changed on both sides to different values
+// are reported in Conflicts for the caller to resolve. OrgId scopes the
+// lookup to the caller's org.
+type MergeDashboardVersionsCommand struct {
+	DashboardId int64
+	OrgId       int64
+	Base        int
+	Ours        int
+	Theirs      int
+
+	Result    *simplejson.Json
+	Conflicts []VersionConflict
+}
@@ -0,0 +1,390 @@
+package sqlstore
+
+import (
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// MAX_VERSIONS_TO_DELETE_PER_BATCH is the number of rows a single DELETE
+// statement removes. All batches of one deleteExpiredVersions call run
+// inside a single transaction.
+const MAX_VERSIONS_TO_DELETE_PER_BATCH = 100
+
+// MAX_VERSION_DELETION_BATCHES caps the number of batches run per call to
+// deleteExpiredVersions, so a single cleanup tick can't block other writers
+// indefinitely.
+const MAX_VERSION_DELETION_BATCHES = 50
+
+func init() {
+	bus.AddHandler("sql", GetDashboardVersion)
+	bus.AddHandler("sql", GetDashboardVersions)
+	bus.AddHandler("sql", DeleteExpiredVersions)
+	bus.AddHandler("sql", GetDashboardVersionRetention)
+	bus.AddHandler("sql", SetDashboardVersionRetention)
+	bus.AddHandler("sql", GetDashboardVersionsBySource)
+}
+
+// GetDashboardVersion gets the dashboard version for the given dashboard ID and version number.
+func GetDashboardVersion(query *models.GetDashboardVersionQuery) error {
+	return inTransaction(func(sess *DBSession) error {
+		version := models.DashboardVersion{}
+		has, err := sess.Where("dashboard_version.dashboard_id=? AND dashboard_version.version=?", query.DashboardId, query.Version).
+			Join("LEFT", "dashboard", "dashboard_version.dashboard_id = dashboard.id").
+			Get(&version)
+		if err != nil {
+			return err
+		}
+		if !has {
+			return models.ErrDashboardVersionNotFound
+		}
+
+		version.Data.Set("id", version.DashboardId)
+
+		query.Result = &models.DashboardVersionMeta{
+			Id:            version.Id,
+			DashboardId:   version.DashboardId,
+			ParentVersion: version.ParentVersion,
+			RestoredFrom:  version.RestoredFrom,
+			Version:       version.Version,
+			Created:       version.Created,
+			Message:       version.Message,
+			Data:          version.Data,
+		}
+		return nil
+	})
+}
+
+// GetDashboardVersions gets all dashboard versions for the given dashboard
+// ID, optionally narrowed to a single provenance via query.Source.
+func GetDashboardVersions(query *models.GetDashboardVersionsQuery) error {
+	return inTransaction(func(sess *DBSession) error {
+		if query.Limit == 0 {
+			query.Limit = 1000
+		}
+
+		sq := sess.Table("dashboard_version").
+			Select(`dashboard_version.id,
+				dashboard_version.dashboard_id,
+				dashboard_version.parent_version,
+				dashboard_version.restored_from,
+				dashboard_version.version,
+				dashboard_version.created,
+				dashboard_version.created_by as created_by_id,
+				dashboard_version.message,
+				dashboard_version.source,
+				dashboard_version.source_ref,
+				dashboard_version.source_revision,
+				"user".login as created_by`).
+			Join("LEFT", "user", `dashboard_version.created_by = "user".id`).
+			Where("dashboard_version.dashboard_id=? AND dashboard_version.version<=? AND dashboard_version.version>=?",
+				query.DashboardId, query.Start+query.Limit, query.Start)
+
+		if query.Source != "" {
+			sq = sq.And("dashboard_version.source=?", query.Source)
+		}
+
+		err := sq.OrderBy("dashboard_version.version DESC").Find(&query.Result)
+		if err != nil {
+			return err
+		}
+
+		if len(query.Result) < 1 {
+			return models.ErrNoVersionsForDashboardId
+		}
+		return nil
+	})
+}
+
+// GetDashboardVersionsBySource fetches every stored version produced by a
+// given source, optionally narrowed to a single SourceRef. This lets an
+// operator diff a dashboard against "what the plugin last shipped" even
+// after the corresponding edit has scrolled out of the normal version list.
+func GetDashboardVersionsBySource(query *models.GetDashboardVersionsBySourceQuery) error {
+	return inTransaction(func(sess *DBSession) error {
+		sq := sess.Table("dashboard_version").
+			Select(`dashboard_version.id,
+				dashboard_version.dashboard_id,
+				dashboard_version.parent_version,
+				dashboard_version.restored_from,
+				dashboard_version.version,
+				dashboard_version.created,
+				dashboard_version.created_by as created_by_id,
+				dashboard_version.message,
+				dashboard_version.source,
+				dashboard_version.source_ref,
+				dashboard_version.source_revision,
+				"user".login as created_by`).
+			Join("LEFT", "user", `dashboard_version.created_by = "user".id`).
+			Where("dashboard_version.source=?", query.Source)
+
+		if query.SourceRef != "" {
+			sq = sq.And("dashboard_version.source_ref=?", query.SourceRef)
+		}
+
+		return sq.OrderBy("dashboard_version.dashboard_id, dashboard_version.version DESC").Find(&query.Result)
+	})
+}
+
+// GetDashboardVersionRetention fetches the per-dashboard retention override,
+// if one has been set. The dashboard must belong to query.OrgId, or
+// ErrDashboardNotFound is returned instead of leaking whether it exists.
+func GetDashboardVersionRetention(query *models.GetDashboardVersionRetentionQuery) error {
+	return inTransaction(func(sess *DBSession) error {
+		if err := checkDashboardInOrg(sess, query.DashboardId, query.OrgId); err != nil {
+			return err
+		}
+
+		retention := models.DashboardVersionRetention{}
+		has, err := sess.Where("dashboard_id=?", query.DashboardId).Get(&retention)
+		if err != nil {
+			return err
+		}
+		if !has {
+			return models.ErrDashboardVersionRetentionNotFound
+		}
+
+		query.Result = &retention
+		return nil
+	})
+}
+
+// SetDashboardVersionRetention sets, or when KeepVersions <= 0 clears, the
+// per-dashboard retention override. A cleared override falls back to any
+// tag-based policy and ultimately to setting.DashboardVersionsToKeep. The
+// dashboard must belong to cmd.OrgId, or ErrDashboardNotFound is returned.
+func SetDashboardVersionRetention(cmd *models.SetDashboardVersionRetentionCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		if err := checkDashboardInOrg(sess, cmd.DashboardId, cmd.OrgId); err != nil {
+			return err
+		}
+
+		if _, err := sess.Exec("DELETE FROM dashboard_version_retention WHERE dashboard_id=?", cmd.DashboardId); err != nil {
+			return err
+		}
+
+		if cmd.KeepVersions <= 0 {
+			return nil
+		}
+
+		_, err := sess.Insert(&models.DashboardVersionRetention{
+			DashboardId:  cmd.DashboardId,
+			KeepVersions: cmd.KeepVersions,
+		})
+		return err
+	})
+}
+
+// checkDashboardInOrg verifies dashboardId exists and belongs to orgId,
+// returning models.ErrDashboardNotFound otherwise.
+func checkDashboardInOrg(sess *DBSession, dashboardId, orgId int64) error {
+	has, err := sess.Where("id=? AND org_id=?", dashboardId, orgId).Get(&models.Dashboard{})
+	if err != nil {
+		return err
+	}
+	if !has {
+		return models.ErrDashboardNotFound
+	}
+	return nil
+}
+
+// effectiveRetention resolves how many versions to keep for a single
+// dashboard: an explicit per-dashboard override wins, then the highest
+// retention configured for any of the dashboard's tags, and finally the
+// global setting.DashboardVersionsToKeep.
+func effectiveRetention(sess *DBSession, dashboardId int64) (int, error) {
+	override := models.DashboardVersionRetention{}
+	has, err := sess.Where("dashboard_id=?", dashboardId).Get(&override)
+	if err != nil {
+		return 0, err
+	}
+	if has {
+		return override.KeepVersions, nil
+	}
+
+	if len(setting.DashboardVersionsToKeepByTag) > 0 {
+		var tags []string
+		err := sess.Table("dashboard_tag").Cols("term").Where("dashboard_id=?", dashboardId).Find(&tags)
+		if err != nil {
+			return 0, err
+		}
+
+		keep := 0
+		for _, tag := range tags {
+			if n, ok := setting.DashboardVersionsToKeepByTag[tag]; ok && n > keep {
+				keep = n
+			}
+		}
+		if keep > 0 {
+			return keep, nil
+		}
+	}
+
+	versionsToKeep := setting.DashboardVersionsToKeep
+	if versionsToKeep < 1 {
+		versionsToKeep = 1
+	}
+	return versionsToKeep, nil
+}
+
+// DeleteExpiredVersions deletes dashboard versions that fall outside each
+// dashboard's effective retention policy, and, when MaxAge is configured,
+// that have also aged out — without ever dropping below the "keep latest N"
+// invariant.
+func DeleteExpiredVersions(cmd *models.DeleteExpiredVersionsCommand) error {
+	return deleteExpiredVersions(cmd, MAX_VERSIONS_TO_DELETE_PER_BATCH, MAX_VERSION_DELETION_BATCHES)
+}
+
+func deleteExpiredVersions(cmd *models.DeleteExpiredVersionsCommand, perBatch, maxBatches int) error {
+	return inTransaction(func(sess *DBSession) error {
+		var dashboardIds []int64
+		if err := sess.Table("dashboard_version").Distinct("dashboard_id").Find(&dashboardIds); err != nil {
+			return err
+		}
+
+		maxAge := cmd.MaxAge
+		if maxAge <= 0 {
+			maxAge = setting.DashboardVersionsMaxAge
+		}
+		var cutoff time.Time
+		if maxAge > 0 {
+			cutoff = time.Now().Add(-maxAge)
+		}
+
+		keepRecent := cmd.KeepRecent
+		if keepRecent <= 0 {
+			keepRecent = setting.DashboardVersionsKeepRecent
+		}
+		keepEvery := cmd.KeepEvery
+		if keepEvery <= 0 {
+			keepEvery = setting.DashboardVersionsKeepEvery
+		}
+		minSnapshotInterval := cmd.MinSnapshotInterval
+		if minSnapshotInterval <= 0 {
+			minSnapshotInterval = setting.DashboardVersionsMinSnapshotInterval
+		}
+
+		var deleted int64
+		batchesUsed := 0
+		for _, dashboardId := range dashboardIds {
+			if batchesUsed >= maxBatches {
+				break
+			}
+
+			keepN, err := effectiveRetention(sess, dashboardId)
+			if err != nil {
+				return err
+			}
+			// KeepRecent is a floor on top of the per-dashboard/tag retention
+			// policy, not an override: it guarantees at least this many recent
+			// versions survive, but never prunes a dashboard more aggressively
+			// than its configured effectiveRetention.
+			if keepRecent > keepN {
+				keepN = keepRecent
+			}
+
+			rows, used, err := pruneDashboardVersions(sess, dashboardId, keepN, keepEvery, minSnapshotInterval, cutoff, perBatch, maxBatches-batchesUsed)
+			if err != nil {
+				return err
+			}
+			deleted += rows
+			batchesUsed += used
+		}
+
+		cmd.DeletedRows = deleted
+		return nil
+	})
+}
+
+// dashboardVersionStamp is the minimal information needed to decide whether
+// a version should be kept.
+type dashboardVersionStamp struct {
+	Id        int64
+	Version   int
+	Created   time.Time
+	Source    models.DashboardVersionSource
+	SourceRef string
+}
+
+// pruneDashboardVersions prunes a single dashboard's history down to the
+// keepRecent most recent versions, plus any version that qualifies as a
+// permanent snapshot: every keepEvery-th version, or the first version at
+// least minInterval newer than the previously kept snapshot. When cutoff is
+// non-zero, a version outside the recent window and not a snapshot is only
+// deleted once it's older than cutoff; the keepRecent invariant always
+// wins, even for versions older than cutoff. The latest plugin-sourced
+// version for each distinct SourceRef is never deleted, so operators can
+// always diff against what the plugin last shipped.
+func pruneDashboardVersions(sess *DBSession, dashboardId int64, keepRecent, keepEvery int, minInterval time.Duration, cutoff time.Time, perBatch, maxBatches int) (int64, int, error) {
+	var stamps []dashboardVersionStamp
+	err := sess.Table("dashboard_version").
+		Cols("id", "version", "created", "source", "source_ref").
+		Where("dashboard_id=?", dashboardId).
+		OrderBy("version ASC").
+		Find(&stamps)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if len(stamps) == 0 {
+		return 0, 0, nil
+	}
+
+	latestPluginVersion := map[string]int{}
+	for _, s := range stamps {
+		if s.Source == models.DashboardVersionSourcePlugin {
+			latestPluginVersion[s.SourceRef] = s.Version
+		}
+	}
+
+	newestKept := stamps[len(stamps)-1].Version - keepRecent
+	var lastSnapshot time.Time
+	var toDelete []int64
+
+	for _, s := range stamps {
+		isSnapshot := keepEvery > 0 && s.Version%keepEvery == 0
+		if minInterval > 0 && (lastSnapshot.IsZero() || s.Created.Sub(lastSnapshot) >= minInterval) {
+			isSnapshot = true
+		}
+		if isSnapshot {
+			lastSnapshot = s.Created
+		}
+
+		if s.Version > newestKept || isSnapshot {
+			continue
+		}
+		if !cutoff.IsZero() && !s.Created.Before(cutoff) {
+			continue
+		}
+		if s.Source == models.DashboardVersionSourcePlugin && latestPluginVersion[s.SourceRef] == s.Version {
+			continue
+		}
+		toDelete = append(toDelete, s.Id)
+	}
+
+	var deleted int64
+	batchesUsed := 0
+	for len(toDelete) > 0 && batchesUsed < maxBatches {
+		n := perBatch
+		if n > len(toDelete) {
+			n = len(toDelete)
+		}
+
+		res, err := sess.In("id", toDelete[:n]).Delete(&models.DashboardVersion{})
+		if err != nil {
+			return deleted, batchesUsed, err
+		}
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return deleted, batchesUsed, err
+		}
+
+		deleted += rows
+		batchesUsed++
+		toDelete = toDelete[n:]
+	}
+
+	return deleted, batchesUsed, nil
+}
@@ -0,0 +1,375 @@
+package sqlstore
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// arrayIdKeyPrefix marks a flattened path segment as keyed by a stable
+// element id rather than by its positional index within the array. See
+// flattenJSON for why this matters.
+const arrayIdKeyPrefix = "id:"
+
+func init() {
+	bus.AddHandler("sql", GetDashboardVersionDiff)
+	bus.AddHandler("sql", MergeDashboardVersions)
+}
+
+// GetDashboardVersionDiff computes an RFC 6902 JSON patch from the dashboard
+// data stored in query.Original to the data stored in query.New. The
+// dashboard must belong to query.OrgId, or ErrDashboardNotFound is
+// returned instead of leaking another org's dashboard JSON.
+func GetDashboardVersionDiff(query *models.GetDashboardVersionDiffQuery) error {
+	return inTransaction(func(sess *DBSession) error {
+		if err := checkDashboardInOrg(sess, query.DashboardId, query.OrgId); err != nil {
+			return err
+		}
+
+		original, err := dashboardVersionData(sess, query.DashboardId, query.Original)
+		if err != nil {
+			return err
+		}
+		newer, err := dashboardVersionData(sess, query.DashboardId, query.New)
+		if err != nil {
+			return err
+		}
+
+		query.Result = diffJSON(original, newer)
+		return nil
+	})
+}
+
+// MergeDashboardVersions performs a three-way merge of a dashboard's JSON
+// across cmd.Base, cmd.Ours and cmd.Theirs. The dashboard must belong to
+// cmd.OrgId, or ErrDashboardNotFound is returned instead of leaking
+// another org's dashboard JSON.
+func MergeDashboardVersions(cmd *models.MergeDashboardVersionsCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		if err := checkDashboardInOrg(sess, cmd.DashboardId, cmd.OrgId); err != nil {
+			return err
+		}
+
+		base, err := dashboardVersionData(sess, cmd.DashboardId, cmd.Base)
+		if err != nil {
+			return err
+		}
+		ours, err := dashboardVersionData(sess, cmd.DashboardId, cmd.Ours)
+		if err != nil {
+			return err
+		}
+		theirs, err := dashboardVersionData(sess, cmd.DashboardId, cmd.Theirs)
+		if err != nil {
+			return err
+		}
+
+		merged, conflicts := threeWayMerge(base, ours, theirs)
+		cmd.Result = simplejson.NewFromAny(merged)
+		cmd.Conflicts = conflicts
+		return nil
+	})
+}
+
+// dashboardVersionData loads the stored dashboard JSON for a single version.
+func dashboardVersionData(sess *DBSession, dashboardId int64, version int) (map[string]interface{}, error) {
+	v := models.DashboardVersion{}
+	has, err := sess.Where("dashboard_id=? AND version=?", dashboardId, version).Get(&v)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, models.ErrDashboardVersionNotFound
+	}
+	return v.Data.MustMap(), nil
+}
+
+// diffJSON returns the RFC 6902 patch operations needed to turn a into b.
+func diffJSON(a, b map[string]interface{}) []models.JSONPatchOp {
+	flatA, flatB := map[string]interface{}{}, map[string]interface{}{}
+	flattenJSON("", a, flatA)
+	flattenJSON("", b, flatB)
+
+	var ops []models.JSONPatchOp
+	for path, av := range flatA {
+		bv, ok := flatB[path]
+		if !ok {
+			ops = append(ops, models.JSONPatchOp{Op: "remove", Path: path})
+			continue
+		}
+		if !reflect.DeepEqual(av, bv) {
+			ops = append(ops, models.JSONPatchOp{Op: "replace", Path: path, Value: bv})
+		}
+	}
+	for path, bv := range flatB {
+		if _, ok := flatA[path]; !ok {
+			ops = append(ops, models.JSONPatchOp{Op: "add", Path: path, Value: bv})
+		}
+	}
+
+	sort.Slice(ops, func(i, j int) bool { return ops[i].Path < ops[j].Path })
+	return ops
+}
+
+// threeWayMerge applies every JSON pointer changed on exactly one side of
+// base relative to base, and reports pointers changed on both sides (to
+// different values) as conflicts.
+func threeWayMerge(base, ours, theirs map[string]interface{}) (map[string]interface{}, []models.VersionConflict) {
+	flatBase, flatOurs, flatTheirs := map[string]interface{}{}, map[string]interface{}{}, map[string]interface{}{}
+	flattenJSON("", base, flatBase)
+	flattenJSON("", ours, flatOurs)
+	flattenJSON("", theirs, flatTheirs)
+
+	paths := map[string]bool{}
+	for p := range flatBase {
+		paths[p] = true
+	}
+	for p := range flatOurs {
+		paths[p] = true
+	}
+	for p := range flatTheirs {
+		paths[p] = true
+	}
+
+	merged := map[string]interface{}{}
+	var conflicts []models.VersionConflict
+
+	for path := range paths {
+		baseVal, baseHas := flatBase[path]
+		oursVal, oursHas := flatOurs[path]
+		theirsVal, theirsHas := flatTheirs[path]
+
+		oursChanged := oursHas != baseHas || !reflect.DeepEqual(oursVal, baseVal)
+		theirsChanged := theirsHas != baseHas || !reflect.DeepEqual(theirsVal, baseVal)
+
+		switch {
+		case !oursChanged && !theirsChanged:
+			setFlat(merged, path, baseVal, baseHas)
+		case oursChanged && !theirsChanged:
+			setFlat(merged, path, oursVal, oursHas)
+		case !oursChanged && theirsChanged:
+			setFlat(merged, path, theirsVal, theirsHas)
+		default:
+			if oursHas == theirsHas && reflect.DeepEqual(oursVal, theirsVal) {
+				setFlat(merged, path, oursVal, oursHas)
+				continue
+			}
+			conflicts = append(conflicts, models.VersionConflict{
+				Path: path, Base: baseVal, Ours: oursVal, Theirs: theirsVal,
+			})
+			// Keep the base value until the conflict is resolved.
+			setFlat(merged, path, baseVal, baseHas)
+		}
+	}
+
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].Path < conflicts[j].Path })
+	return unflattenJSON(merged), conflicts
+}
+
+func setFlat(flat map[string]interface{}, path string, value interface{}, has bool) {
+	if has {
+		flat[path] = value
+	}
+}
+
+// flattenJSON walks a decoded JSON value, recording each leaf under its
+// JSON pointer path relative to prefix. Paths follow RFC 6901 except for the
+// "id:<id>" array segments described below.
+//
+// Array elements that are objects carrying a stable, unique "id" field
+// (dashboard panels, rows and templating variables all do) are keyed by
+// that id rather than by position: inserting or removing one element
+// would otherwise shift every following element's index, making every
+// element after the edit look changed even though only one actually was.
+// Arrays that aren't uniformly id-able (e.g. a plain string tags array)
+// keep positional indices, which are stable under edits to a scalar list.
+func flattenJSON(prefix string, v interface{}, out map[string]interface{}) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if len(val) == 0 {
+			out[prefix] = val
+			return
+		}
+		for k, cv := range val {
+			flattenJSON(prefix+"/"+escapeJSONPointer(k), cv, out)
+		}
+	case []interface{}:
+		if len(val) == 0 {
+			out[prefix] = val
+			return
+		}
+		ids := arrayElementIds(val)
+		for i, cv := range val {
+			seg := strconv.Itoa(i)
+			if ids != nil {
+				seg = arrayIdKeyPrefix + escapeJSONPointer(ids[i])
+			}
+			flattenJSON(prefix+"/"+seg, cv, out)
+		}
+	default:
+		out[prefix] = v
+	}
+}
+
+// arrayElementIds returns, for every element of arr, the string form of
+// its "id" field, or nil if any element isn't a map with a unique scalar
+// "id" — in which case the caller should fall back to positional indices.
+func arrayElementIds(arr []interface{}) []string {
+	ids := make([]string, len(arr))
+	seen := make(map[string]bool, len(arr))
+	for i, el := range arr {
+		m, ok := el.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		id, ok := m["id"]
+		if !ok {
+			return nil
+		}
+		key, ok := scalarString(id)
+		if !ok || seen[key] {
+			return nil
+		}
+		seen[key] = true
+		ids[i] = key
+	}
+	return ids
+}
+
+// scalarString renders a decoded JSON scalar as a string suitable for use
+// as a map key, or reports false for composite values.
+func scalarString(v interface{}) (string, bool) {
+	switch t := v.(type) {
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), true
+	case string:
+		return t, true
+	case bool:
+		return strconv.FormatBool(t), true
+	default:
+		return "", false
+	}
+}
+
+// unflattenJSON rebuilds a nested JSON structure from a set of RFC 6901
+// pointer paths, reconstructing arrays where every key of a node is an
+// integer index (indices missing from the node come back as null) or an
+// id-keyed segment.
+func unflattenJSON(flat map[string]interface{}) map[string]interface{} {
+	root := map[string]interface{}{}
+	for path, value := range flat {
+		segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+		setPath(root, segments, value)
+	}
+	return arrayify(root).(map[string]interface{})
+}
+
+func setPath(node map[string]interface{}, segments []string, value interface{}) {
+	seg := unescapeJSONPointer(segments[0])
+	if len(segments) == 1 {
+		node[seg] = value
+		return
+	}
+	child, ok := node[seg].(map[string]interface{})
+	if !ok {
+		child = map[string]interface{}{}
+		node[seg] = child
+	}
+	setPath(child, segments[1:], value)
+}
+
+// arrayify converts any map whose keys are all integer indices, or all
+// id-keyed (see flattenJSON), into a slice, recursively. Integer keys need
+// not be contiguous: the slice runs from 0 to the largest index and any
+// index not present is left nil.
+func arrayify(v interface{}) interface{} {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	for k, cv := range m {
+		m[k] = arrayify(cv)
+	}
+
+	switch {
+	case looksLikePositionalArray(m):
+		maxIndex := -1
+		for k := range m {
+			i, _ := strconv.Atoi(k)
+			if i > maxIndex {
+				maxIndex = i
+			}
+		}
+		out := make([]interface{}, maxIndex+1)
+		for k, cv := range m {
+			i, _ := strconv.Atoi(k)
+			out[i] = cv
+		}
+		return out
+	case looksLikeIdKeyedArray(m):
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return lessArrayId(keys[i], keys[j]) })
+		out := make([]interface{}, len(keys))
+		for i, k := range keys {
+			out[i] = m[k]
+		}
+		return out
+	default:
+		return m
+	}
+}
+
+func looksLikePositionalArray(m map[string]interface{}) bool {
+	if len(m) == 0 {
+		return false
+	}
+	for k := range m {
+		if _, err := strconv.Atoi(k); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func looksLikeIdKeyedArray(m map[string]interface{}) bool {
+	if len(m) == 0 {
+		return false
+	}
+	for k := range m {
+		if !strings.HasPrefix(k, arrayIdKeyPrefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// lessArrayId orders id-keyed array segments numerically when both ids
+// parse as numbers (the common case for panel/row ids), falling back to a
+// lexical comparison otherwise.
+func lessArrayId(a, b string) bool {
+	av, aErr := strconv.ParseFloat(strings.TrimPrefix(a, arrayIdKeyPrefix), 64)
+	bv, bErr := strconv.ParseFloat(strings.TrimPrefix(b, arrayIdKeyPrefix), 64)
+	if aErr == nil && bErr == nil {
+		return av < bv
+	}
+	return a < b
+}
+
+func escapeJSONPointer(s string) string {
+	s = strings.ReplaceAll(s, "~", "~0")
+	s = strings.ReplaceAll(s, "/", "~1")
+	return s
+}
+
+func unescapeJSONPointer(s string) string {
+	s = strings.ReplaceAll(s, "~1", "/")
+	s = strings.ReplaceAll(s, "~0", "~")
+	return s
+}
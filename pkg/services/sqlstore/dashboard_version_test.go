@@ -4,7 +4,9 @@ package sqlstore
 
 import (
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/grafana/grafana/pkg/components/simplejson"
 	"github.com/grafana/grafana/pkg/models"
@@ -12,6 +14,27 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+func backdateDashboardVersion(t *testing.T, dashboardId int64, version int, created time.Time) {
+	t.Helper()
+
+	err := inTransaction(func(sess *DBSession) error {
+		_, err := sess.Exec("UPDATE dashboard_version SET created=? WHERE dashboard_id=? AND version=?", created, dashboardId, version)
+		return err
+	})
+	require.NoError(t, err)
+}
+
+func setDashboardVersionSource(t *testing.T, dashboardId int64, version int, source models.DashboardVersionSource, sourceRef string) {
+	t.Helper()
+
+	err := inTransaction(func(sess *DBSession) error {
+		_, err := sess.Exec("UPDATE dashboard_version SET source=?, source_ref=? WHERE dashboard_id=? AND version=?",
+			source, sourceRef, dashboardId, version)
+		return err
+	})
+	require.NoError(t, err)
+}
+
 func updateTestDashboard(t *testing.T, sqlStore *SQLStore, dashboard *models.Dashboard, data map[string]interface{}) {
 	t.Helper()
 
@@ -69,6 +92,171 @@ func TestGetDashboardVersion(t *testing.T) {
 	})
 }
 
+func TestGetDashboardVersionDiff(t *testing.T) {
+	t.Run("Testing dashboard version diff and merge", func(t *testing.T) {
+		sqlStore := InitTestDB(t)
+		savedDash := insertTestDashboard(t, sqlStore, "test dash diff", 1, 0, false, "diff")
+
+		updateTestDashboard(t, sqlStore, savedDash, map[string]interface{}{
+			"title": "renamed by ours",
+			"tags":  "diff",
+		})
+		oursVersion := savedDash.Version + 1
+
+		t.Run("Computes a JSON patch between two versions", func(t *testing.T) {
+			query := models.GetDashboardVersionDiffQuery{
+				DashboardId: savedDash.Id,
+				OrgId:       1,
+				Original:    savedDash.Version,
+				New:         oursVersion,
+			}
+			err := GetDashboardVersionDiff(&query)
+			require.NoError(t, err)
+			require.NotEmpty(t, query.Result)
+
+			found := false
+			for _, op := range query.Result {
+				if op.Path == "/title" {
+					require.Equal(t, "replace", op.Op)
+					require.Equal(t, "renamed by ours", op.Value)
+					found = true
+				}
+			}
+			require.True(t, found, "expected a replace op for /title")
+		})
+
+		t.Run("Merges non-conflicting changes and reports conflicts", func(t *testing.T) {
+			cmd := models.MergeDashboardVersionsCommand{
+				DashboardId: savedDash.Id,
+				OrgId:       1,
+				Base:        savedDash.Version,
+				Ours:        oursVersion,
+				Theirs:      savedDash.Version,
+			}
+			err := MergeDashboardVersions(&cmd)
+			require.NoError(t, err)
+			require.Empty(t, cmd.Conflicts)
+
+			merged, err := cmd.Result.Get("title").String()
+			require.NoError(t, err)
+			require.Equal(t, "renamed by ours", merged)
+		})
+
+		t.Run("Reports a conflict when ours and theirs both change the same pointer", func(t *testing.T) {
+			updateTestDashboard(t, sqlStore, savedDash, map[string]interface{}{
+				"title": "renamed by theirs",
+				"tags":  "diff",
+			})
+			theirsVersion := oursVersion + 1
+
+			baseQuery := models.GetDashboardVersionQuery{DashboardId: savedDash.Id, Version: savedDash.Version, OrgId: 1}
+			err := GetDashboardVersion(&baseQuery)
+			require.NoError(t, err)
+			baseTitle, err := baseQuery.Result.Data.Get("title").String()
+			require.NoError(t, err)
+
+			cmd := models.MergeDashboardVersionsCommand{
+				DashboardId: savedDash.Id,
+				OrgId:       1,
+				Base:        savedDash.Version,
+				Ours:        oursVersion,
+				Theirs:      theirsVersion,
+			}
+			err = MergeDashboardVersions(&cmd)
+			require.NoError(t, err)
+			require.Len(t, cmd.Conflicts, 1)
+
+			conflict := cmd.Conflicts[0]
+			require.Equal(t, "/title", conflict.Path)
+			require.Equal(t, baseTitle, conflict.Base)
+			require.Equal(t, "renamed by ours", conflict.Ours)
+			require.Equal(t, "renamed by theirs", conflict.Theirs)
+		})
+
+		t.Run("Keys array elements by stable id so an unrelated element isn't spuriously diffed", func(t *testing.T) {
+			updateTestDashboard(t, sqlStore, savedDash, map[string]interface{}{
+				"panels": []interface{}{
+					map[string]interface{}{"id": 1, "title": "Panel One"},
+					map[string]interface{}{"id": 2, "title": "Panel Two"},
+					map[string]interface{}{"id": 3, "title": "Panel Three"},
+				},
+			})
+			panelsBaseVersion := oursVersion + 2
+
+			updateTestDashboard(t, sqlStore, savedDash, map[string]interface{}{
+				"panels": []interface{}{
+					map[string]interface{}{"id": 1, "title": "Panel One"},
+					map[string]interface{}{"id": 3, "title": "Panel Three"},
+				},
+			})
+			panelsNewVersion := panelsBaseVersion + 1
+
+			query := models.GetDashboardVersionDiffQuery{
+				DashboardId: savedDash.Id,
+				OrgId:       1,
+				Original:    panelsBaseVersion,
+				New:         panelsNewVersion,
+			}
+			err := GetDashboardVersionDiff(&query)
+			require.NoError(t, err)
+
+			removed := false
+			for _, op := range query.Result {
+				require.False(t, strings.HasPrefix(op.Path, "/panels/id:3/"), "panel 3 is unchanged and shouldn't appear in the diff, got %+v", op)
+				if strings.HasPrefix(op.Path, "/panels/id:2/") {
+					require.Equal(t, "remove", op.Op)
+					removed = true
+				}
+			}
+			require.True(t, removed, "expected remove ops for the deleted panel 2")
+		})
+
+		t.Run("Merges edits to different array elements without a spurious conflict", func(t *testing.T) {
+			updateTestDashboard(t, sqlStore, savedDash, map[string]interface{}{
+				"panels": []interface{}{
+					map[string]interface{}{"id": 1, "title": "Panel One"},
+					map[string]interface{}{"id": 2, "title": "Panel Two"},
+				},
+			})
+			mergeBase := oursVersion + 4
+
+			updateTestDashboard(t, sqlStore, savedDash, map[string]interface{}{
+				"panels": []interface{}{
+					map[string]interface{}{"id": 2, "title": "Panel Two"},
+				},
+			})
+			mergeOurs := mergeBase + 1
+
+			updateTestDashboard(t, sqlStore, savedDash, map[string]interface{}{
+				"panels": []interface{}{
+					map[string]interface{}{"id": 1, "title": "Panel One"},
+					map[string]interface{}{"id": 2, "title": "Panel Two (edited)"},
+				},
+			})
+			mergeTheirs := mergeOurs + 1
+
+			cmd := models.MergeDashboardVersionsCommand{
+				DashboardId: savedDash.Id,
+				OrgId:       1,
+				Base:        mergeBase,
+				Ours:        mergeOurs,
+				Theirs:      mergeTheirs,
+			}
+			err := MergeDashboardVersions(&cmd)
+			require.NoError(t, err)
+			require.Empty(t, cmd.Conflicts, "removing panel 1 on one side and editing panel 2 on the other shouldn't conflict")
+
+			panels, err := cmd.Result.Get("panels").Array()
+			require.NoError(t, err)
+			require.Len(t, panels, 1)
+
+			panel, ok := panels[0].(map[string]interface{})
+			require.True(t, ok)
+			require.Equal(t, "Panel Two (edited)", panel["title"])
+		})
+	})
+}
+
 func TestGetDashboardVersions(t *testing.T) {
 	t.Run("Testing dashboard versions retrieval", func(t *testing.T) {
 		sqlStore := InitTestDB(t)
@@ -171,3 +359,142 @@ func TestDeleteExpiredVersions(t *testing.T) {
 		})
 	})
 }
+
+func TestDeleteExpiredVersionsWithSnapshots(t *testing.T) {
+	t.Run("Testing dashboard version snapshot retention", func(t *testing.T) {
+		sqlStore := InitTestDB(t)
+		versionsToWrite := 100
+		keepRecent := 5
+		keepEvery := 10
+		// KeepRecent only raises the effective retention, so lower the global
+		// default below it for the recent window to be exactly keepRecent.
+		setting.DashboardVersionsToKeep = 1
+
+		savedDash := insertTestDashboard(t, sqlStore, "test dash snapshots", 1, 0, false, "diff-all")
+		for i := 0; i < versionsToWrite-1; i++ {
+			updateTestDashboard(t, sqlStore, savedDash, map[string]interface{}{
+				"tags": "different-tag",
+			})
+		}
+
+		t.Run("Keeps the recent window plus every Kth version as a snapshot", func(t *testing.T) {
+			err := DeleteExpiredVersions(&models.DeleteExpiredVersionsCommand{
+				KeepRecent: keepRecent,
+				KeepEvery:  keepEvery,
+			})
+			require.NoError(t, err)
+
+			query := models.GetDashboardVersionsQuery{DashboardId: savedDash.Id, OrgId: 1, Limit: versionsToWrite}
+			err = GetDashboardVersions(&query)
+			require.NoError(t, err)
+
+			want := map[int]bool{}
+			for v := versionsToWrite - keepRecent + 1; v <= versionsToWrite; v++ {
+				want[v] = true
+			}
+			for v := keepEvery; v <= versionsToWrite; v += keepEvery {
+				want[v] = true
+			}
+
+			got := map[int]bool{}
+			for _, v := range query.Result {
+				got[v.Version] = true
+			}
+			require.Equal(t, want, got)
+		})
+	})
+}
+
+func TestDeleteExpiredVersionsKeepsPluginBaselines(t *testing.T) {
+	t.Run("Testing plugin baselines survive aggressive pruning", func(t *testing.T) {
+		sqlStore := InitTestDB(t)
+		versionsToKeep := 2
+		setting.DashboardVersionsToKeep = versionsToKeep
+
+		savedDash := insertTestDashboard(t, sqlStore, "test dash plugin provenance", 1, 0, false, "diff-all")
+
+		// v1 is the initial user-created save. v2 simulates pluginA's first
+		// upgrade, then user edits happen, pluginB ships its own dashboard,
+		// and finally more user edits push both plugin versions well outside
+		// the retention window.
+		updateTestDashboard(t, sqlStore, savedDash, map[string]interface{}{"tags": "different-tag"}) // v2: pluginA
+		setDashboardVersionSource(t, savedDash.Id, 2, models.DashboardVersionSourcePlugin, "pluginA/dashboard.json")
+
+		updateTestDashboard(t, sqlStore, savedDash, map[string]interface{}{"tags": "different-tag"}) // v3: user
+
+		updateTestDashboard(t, sqlStore, savedDash, map[string]interface{}{"tags": "different-tag"}) // v4: pluginB
+		setDashboardVersionSource(t, savedDash.Id, 4, models.DashboardVersionSourcePlugin, "pluginB/dashboard.json")
+
+		for i := 0; i < 4; i++ {
+			updateTestDashboard(t, sqlStore, savedDash, map[string]interface{}{"tags": "different-tag"}) // v5-v8: user
+		}
+
+		t.Run("Both plugin baselines survive even though only the latest 2 versions are kept otherwise", func(t *testing.T) {
+			err := DeleteExpiredVersions(&models.DeleteExpiredVersionsCommand{})
+			require.NoError(t, err)
+
+			query := models.GetDashboardVersionsQuery{DashboardId: savedDash.Id, OrgId: 1, Limit: 100}
+			err = GetDashboardVersions(&query)
+			require.NoError(t, err)
+
+			got := map[int]bool{}
+			for _, v := range query.Result {
+				got[v.Version] = true
+			}
+
+			want := map[int]bool{2: true, 4: true, 7: true, 8: true}
+			require.Equal(t, want, got)
+		})
+	})
+}
+
+func TestDeleteExpiredVersionsWithMaxAge(t *testing.T) {
+	t.Run("Testing dashboard version time-based expiration", func(t *testing.T) {
+		sqlStore := InitTestDB(t)
+		versionsToWrite := 20
+		versionsToKeep := 3
+		maxAge := 7 * 24 * time.Hour
+		setting.DashboardVersionsToKeep = versionsToKeep
+
+		savedDash := insertTestDashboard(t, sqlStore, "test dash max age", 1, 0, false, "diff-all")
+		for i := 0; i < versionsToWrite-1; i++ {
+			updateTestDashboard(t, sqlStore, savedDash, map[string]interface{}{
+				"tags": "different-tag",
+			})
+		}
+
+		// Spread the 20 versions evenly across a two week span, oldest first.
+		now := time.Now()
+		for v := 1; v <= versionsToWrite; v++ {
+			age := time.Duration(versionsToWrite-v) * (14 * 24 * time.Hour) / time.Duration(versionsToWrite)
+			backdateDashboardVersion(t, savedDash.Id, v, now.Add(-age))
+		}
+
+		t.Run("Keeps versions newer than MaxAge, plus at least VersionsToKeep regardless of age", func(t *testing.T) {
+			err := DeleteExpiredVersions(&models.DeleteExpiredVersionsCommand{MaxAge: maxAge})
+			require.NoError(t, err)
+
+			query := models.GetDashboardVersionsQuery{DashboardId: savedDash.Id, OrgId: 1, Limit: versionsToWrite}
+			err = GetDashboardVersions(&query)
+			require.NoError(t, err)
+
+			cutoff := now.Add(-maxAge)
+			want := map[int]bool{}
+			for v := versionsToWrite - versionsToKeep + 1; v <= versionsToWrite; v++ {
+				want[v] = true
+			}
+			for v := 1; v <= versionsToWrite; v++ {
+				age := time.Duration(versionsToWrite-v) * (14 * 24 * time.Hour) / time.Duration(versionsToWrite)
+				if now.Add(-age).After(cutoff) {
+					want[v] = true
+				}
+			}
+
+			got := map[int]bool{}
+			for _, v := range query.Result {
+				got[v.Version] = true
+			}
+			require.Equal(t, want, got)
+		})
+	})
+}
@@ -0,0 +1,20 @@
+package migrations
+
+import (
+	. "github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+)
+
+// addDashboardVersionRetentionMigration creates the table backing
+// GetDashboardVersionRetention/SetDashboardVersionRetention: a per-dashboard
+// override of how many versions of history to retain.
+func addDashboardVersionRetentionMigration(mg *Migrator) {
+	table := Table{
+		Name: "dashboard_version_retention",
+		Columns: []*Column{
+			{Name: "dashboard_id", Type: DB_BigInt, IsPrimaryKey: true},
+			{Name: "keep_versions", Type: DB_Int, Nullable: false},
+		},
+	}
+
+	mg.AddMigration("create dashboard_version_retention table", NewAddTableMigration(table))
+}
@@ -0,0 +1,22 @@
+package migrations
+
+import (
+	. "github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+)
+
+// addDashboardVersionSourceMigration adds the provenance columns consulted
+// by GetDashboardVersionsBySource and by the pruning job's plugin-baseline
+// protection: source, source_ref and source_revision.
+func addDashboardVersionSourceMigration(mg *Migrator) {
+	table := Table{Name: "dashboard_version"}
+
+	mg.AddMigration("add dashboard_version.source column", NewAddColumnMigration(table, &Column{
+		Name: "source", Type: DB_NVarchar, Length: 40, Nullable: false, Default: "'user'",
+	}))
+	mg.AddMigration("add dashboard_version.source_ref column", NewAddColumnMigration(table, &Column{
+		Name: "source_ref", Type: DB_NVarchar, Length: 255, Nullable: false, Default: "''",
+	}))
+	mg.AddMigration("add dashboard_version.source_revision column", NewAddColumnMigration(table, &Column{
+		Name: "source_revision", Type: DB_NVarchar, Length: 255, Nullable: false, Default: "''",
+	}))
+}
@@ -0,0 +1,12 @@
+package migrations
+
+import (
+	. "github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+)
+
+// AddMigrations registers every schema migration for the dashboard version
+// subsystem, in the order they must run.
+func AddMigrations(mg *Migrator) {
+	addDashboardVersionRetentionMigration(mg)
+	addDashboardVersionSourceMigration(mg)
+}
@@ -0,0 +1,32 @@
+package setting
+
+import "time"
+
+// DashboardVersionsToKeep is the global default number of dashboard
+// versions retained per dashboard once nothing more specific overrides it.
+var DashboardVersionsToKeep int = 20
+
+// DashboardVersionsToKeepByTag maps a dashboard tag to the number of
+// versions that should be kept for any dashboard carrying that tag. When a
+// dashboard carries more than one configured tag, the highest value wins.
+// This is consulted only when the dashboard has no per-dashboard override.
+var DashboardVersionsToKeepByTag map[string]int
+
+// DashboardVersionsMaxAge is the global default age after which a dashboard
+// version becomes eligible for time-based expiration, on top of the
+// count-based retention policy. It never overrides the "keep latest N"
+// invariant: the most recent versions a dashboard is entitled to keep are
+// preserved regardless of age. Zero disables time-based expiration.
+var DashboardVersionsMaxAge time.Duration
+
+// DashboardVersionsKeepRecent, DashboardVersionsKeepEvery and
+// DashboardVersionsMinSnapshotInterval configure the IAVL-style snapshot
+// retention tier: besides the KeepRecent most recent versions, any version
+// that is a multiple of KeepEvery, or at least MinSnapshotInterval newer
+// than the previous kept snapshot, is preserved permanently as a
+// long-term audit trail. They are used only as defaults for a
+// DeleteExpiredVersionsCommand whose corresponding field is left zero; zero
+// values here disable the snapshot tier entirely.
+var DashboardVersionsKeepRecent int
+var DashboardVersionsKeepEvery int
+var DashboardVersionsMinSnapshotInterval time.Duration